@@ -0,0 +1,101 @@
+// Package aws wraps the two STS calls needed to turn a SAML assertion into
+// usable AWS credentials: assuming a role with SAML, and (optionally)
+// chaining into a second role from the resulting session. Pulling this out
+// of the Okta client lets any SAMLProvider implementation reuse the same
+// credential exchange.
+package aws
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Credentials holds a set of temporary AWS credentials returned by STS.
+type Credentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// AssumeSAMLRole exchanges a SAML assertion for temporary credentials via
+// sts:AssumeRoleWithSAML.
+func AssumeSAMLRole(principalArn, roleArn, samlAssertion string, duration time.Duration, region string) (*Credentials, error) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String(region)}))
+	svc := sts.New(sess)
+
+	resp, err := svc.AssumeRoleWithSAML(&sts.AssumeRoleWithSAMLInput{
+		PrincipalArn:    aws.String(principalArn),
+		RoleArn:         aws.String(roleArn),
+		SAMLAssertion:   aws.String(samlAssertion),
+		DurationSeconds: aws.Int64(int64(duration.Seconds())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{
+		AccessKeyId:     *resp.Credentials.AccessKeyId,
+		SecretAccessKey: *resp.Credentials.SecretAccessKey,
+		SessionToken:    *resp.Credentials.SessionToken,
+		Expiration:      *resp.Credentials.Expiration,
+	}, nil
+}
+
+// chainAssumeRoleMinDuration and chainAssumeRoleMaxDuration are STS's
+// limits on DurationSeconds when assuming a role using credentials that
+// are themselves the result of an assumed role ("role chaining") — AWS
+// caps this at one hour regardless of the target role's own
+// MaxSessionDuration.
+const (
+	chainAssumeRoleMinDuration = 15 * time.Minute
+	chainAssumeRoleMaxDuration = time.Hour
+)
+
+// clampChainDuration clamps d to the range STS accepts for a chained
+// AssumeRole call.
+func clampChainDuration(d time.Duration) time.Duration {
+	if d < chainAssumeRoleMinDuration {
+		return chainAssumeRoleMinDuration
+	}
+	if d > chainAssumeRoleMaxDuration {
+		return chainAssumeRoleMaxDuration
+	}
+	return d
+}
+
+// ChainAssumeRole assumes roleArn using creds as the calling identity, via
+// sts:AssumeRole. This is used to hop from the SAML-assumed role into the
+// role the user actually asked for. duration is clamped to the range STS
+// allows for a chained AssumeRole call (15 minutes to 1 hour).
+func ChainAssumeRole(creds *Credentials, roleArn, sessionName string, duration time.Duration, region string) (*Credentials, error) {
+	sess := session.New(&aws.Config{
+		Region: aws.String(region),
+		Credentials: credentials.NewStaticCredentials(
+			creds.AccessKeyId,
+			creds.SecretAccessKey,
+			creds.SessionToken,
+		),
+	})
+	svc := sts.New(sess)
+
+	resp, err := svc.AssumeRole(&sts.AssumeRoleInput{
+		RoleArn:         aws.String(roleArn),
+		RoleSessionName: aws.String(sessionName),
+		DurationSeconds: aws.Int64(int64(clampChainDuration(duration).Seconds())),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credentials{
+		AccessKeyId:     *resp.Credentials.AccessKeyId,
+		SecretAccessKey: *resp.Credentials.SecretAccessKey,
+		SessionToken:    *resp.Credentials.SessionToken,
+		Expiration:      *resp.Credentials.Expiration,
+	}, nil
+}
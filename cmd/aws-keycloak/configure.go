@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/manifoldco/promptui"
+	homedir "github.com/mitchellh/go-homedir"
+	okta "github.com/segmentio/aws-okta"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// samlAppLinkPattern matches the AWS SAML app links Okta's "App Home" page
+// embeds, e.g. href="/home/amazon_aws/0oa25q58sjnJXnvIg1t7/272".
+var samlAppLinkPattern = regexp.MustCompile(`(home/amazon_aws/[\w]+/\d+)`)
+
+// configureCommand does best-effort discovery of the user's AWS SAML app
+// URL by scraping their Okta dashboard (similar to saml2aws's app
+// discovery) and writes it into a profile entry in ConfigPath.
+var configureCommand = cli.Command{
+	Name:  "configure",
+	Usage: "discover the AWS SAML app URL and save it for a profile",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "organization", Usage: "Okta organization"},
+		cli.StringFlag{Name: "domain", Value: okta.OktaServer, Usage: "Okta domain, e.g. okta.com"},
+		cli.StringFlag{Name: "username", EnvVar: "OKTA_USERNAME", Usage: "Okta username"},
+		cli.StringFlag{Name: "profile", Usage: "AWS profile name to save the discovered app URL under"},
+	},
+	Action: func(c *cli.Context) error {
+		organization := c.String("organization")
+		username := c.String("username")
+		profile := c.String("profile")
+		if organization == "" || username == "" || profile == "" {
+			return fmt.Errorf("--organization, --username and --profile are required")
+		}
+
+		password := os.Getenv("OKTA_PASSWORD")
+		if password == "" {
+			prompt := promptui.Prompt{Label: "Okta password", Mask: '*'}
+			var err error
+			password, err = prompt.Run()
+			if err != nil {
+				return err
+			}
+		}
+
+		client := okta.NewOktaClient(organization, c.String("domain"), username, password)
+		if err := client.Login(); err != nil {
+			return err
+		}
+
+		appURL, err := discoverSAMLAppURL(client, organization, c.String("domain"))
+		if err != nil {
+			return err
+		}
+
+		if err := saveProfileSAMLAppURL(profile, appURL); err != nil {
+			return err
+		}
+
+		fmt.Printf("saved saml_app_url %s for profile %s\n", appURL, profile)
+		return nil
+	},
+}
+
+func discoverSAMLAppURL(client *okta.OktaClient, organization, domain string) (string, error) {
+	resp, err := client.HTTPClient().Get(fmt.Sprintf("https://%s.%s/app/UserHome", organization, domain))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	match := samlAppLinkPattern.FindString(string(body))
+	if match == "" {
+		return "", fmt.Errorf("no AWS SAML app found on the Okta dashboard")
+	}
+	return match, nil
+}
+
+func saveProfileSAMLAppURL(profile, appURL string) error {
+	cfg, err := okta.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]okta.ProfileConfig{}
+	}
+	pc := cfg.Profiles[profile]
+	pc.SAMLAppURL = appURL
+	cfg.Profiles[profile] = pc
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	path, err := homedir.Expand(okta.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/manifoldco/promptui"
+	okta "github.com/segmentio/aws-okta"
+	"github.com/urfave/cli"
+)
+
+func main() {
+	app := cli.NewApp()
+	app.Name = "aws-keycloak"
+	app.Usage = "authenticate to AWS via Okta SAML"
+	app.Commands = []cli.Command{
+		credProcessCommand,
+		serverCommand,
+		configureCommand,
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err.Error())
+	}
+}
+
+var commonFlags = []cli.Flag{
+	cli.StringFlag{Name: "organization", Usage: "Okta organization (defaults to okta_organization in the config file)"},
+	cli.StringFlag{Name: "domain", Usage: "Okta domain, e.g. okta.com (defaults to okta_domain in the config file)"},
+	cli.StringFlag{Name: "username", EnvVar: "OKTA_USERNAME", Usage: "Okta username"},
+	cli.StringFlag{Name: "role-arn", Usage: "AWS role to assume (defaults to the profile's role_arn)"},
+	cli.StringFlag{Name: "profile", Usage: "AWS profile name (used for config lookup, caching and session naming)"},
+}
+
+func newClientFromContext(c *cli.Context) (*okta.OktaClient, string, string, error) {
+	profile := c.String("profile")
+	if profile == "" {
+		return nil, "", "", fmt.Errorf("--profile is required")
+	}
+
+	cfg, err := okta.LoadConfig()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	organization := c.String("organization")
+	if organization == "" {
+		organization = cfg.OktaOrganization
+	}
+	domain := c.String("domain")
+	if domain == "" {
+		domain = cfg.OktaDomain
+	}
+	roleArn := c.String("role-arn")
+	if roleArn == "" {
+		roleArn = cfg.Profiles[profile].RoleArn
+	}
+	username := c.String("username")
+	if organization == "" || username == "" || roleArn == "" {
+		return nil, "", "", fmt.Errorf("--organization (or okta_organization in the config file), --username and --role-arn (or role_arn in the config file) are required")
+	}
+
+	password := os.Getenv("OKTA_PASSWORD")
+	if password == "" {
+		prompt := promptui.Prompt{Label: "Okta password", Mask: '*'}
+		password, err = prompt.Run()
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+
+	return okta.NewOktaClient(organization, domain, username, password), roleArn, profile, nil
+}
+
+var credProcessCommand = cli.Command{
+	Name:  "cred-process",
+	Usage: "print credentials in the AWS credential_process JSON schema",
+	Flags: commonFlags,
+	Action: func(c *cli.Context) error {
+		client, roleArn, profile, err := newClientFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		if err := client.Authenticate(roleArn, profile); err != nil {
+			return err
+		}
+
+		return json.NewEncoder(os.Stdout).Encode(client.CredentialProcess())
+	},
+}
+
+var serverCommand = cli.Command{
+	Name:  "server",
+	Usage: "serve credentials over the EC2 instance-metadata-service API",
+	Flags: append(commonFlags,
+		cli.StringFlag{Name: "listen-addr", Value: "127.0.0.1:8080", Usage: "address to listen on"},
+		cli.StringFlag{Name: "ec2-role", Value: "aws-keycloak", Usage: "role name exposed at iam/security-credentials/<name>"},
+	),
+	Action: func(c *cli.Context) error {
+		client, roleArn, profile, err := newClientFromContext(c)
+		if err != nil {
+			return err
+		}
+
+		server := &okta.IMDSServer{
+			Client:  client,
+			RoleArn: roleArn,
+			Profile: profile,
+			Role:    c.String("ec2-role"),
+		}
+
+		log.Infof("serving instance metadata credentials on %s", c.String("listen-addr"))
+		return http.ListenAndServe(c.String("listen-addr"), server)
+	},
+}
@@ -0,0 +1,83 @@
+package okta
+
+import (
+	"io/ioutil"
+	"os"
+
+	homedir "github.com/mitchellh/go-homedir"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ConfigPath is the default location of the aws-keycloak config file. Its
+// settings override the hardcoded OktaServer/OktaAwsSAMLUrl/DefaultRegion
+// defaults and supply the Okta organization, so it works for orgs other
+// than Segment's.
+const ConfigPath = "~/.aws-keycloak/config.yaml"
+
+// DefaultDuration is how long assumed role credentials last when a
+// profile doesn't set duration_seconds.
+const DefaultDuration = 3600
+
+// Config is the parsed contents of ConfigPath: Okta-wide settings plus a
+// set of named AWS profiles.
+type Config struct {
+	OktaDomain       string                   `yaml:"okta_domain"`
+	OktaOrganization string                   `yaml:"okta_organization"`
+	Profiles         map[string]ProfileConfig `yaml:"profiles"`
+}
+
+// ProfileConfig is the aws-keycloak configuration for a single profile.
+type ProfileConfig struct {
+	SAMLAppURL      string `yaml:"saml_app_url"`
+	RoleArn         string `yaml:"role_arn"`
+	SourceRole      string `yaml:"source_role"`
+	Region          string `yaml:"region"`
+	DurationSeconds int    `yaml:"duration_seconds"`
+	MFAFactor       string `yaml:"mfa_factor"`
+}
+
+// LoadConfig reads and parses ConfigPath. A missing file is not an error;
+// callers get a zero-value Config. okta_domain, saml_app_url, region and
+// duration_seconds then fall back to their built-in defaults; the other
+// settings have no default.
+func LoadConfig() (cfg Config, err error) {
+	path, err := homedir.Expand(ConfigPath)
+	if err != nil {
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	err = yaml.Unmarshal(data, &cfg)
+	return
+}
+
+// LoadProfileConfig returns the profiles[profile] entry of ConfigPath. It
+// is not an error for the file or the profile entry to be missing;
+// callers get a zero-value ProfileConfig in that case.
+func LoadProfileConfig(profile string) (pc ProfileConfig, err error) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return
+	}
+	return cfg.Profiles[profile], nil
+}
+
+// samlAppURL returns the profile's saml_app_url override, or the
+// Segment-specific default if it hasn't set one.
+func samlAppURL(profile string) (string, error) {
+	pc, err := LoadProfileConfig(profile)
+	if err != nil {
+		return "", err
+	}
+	if pc.SAMLAppURL != "" {
+		return pc.SAMLAppURL, nil
+	}
+	return OktaAwsSAMLUrl, nil
+}
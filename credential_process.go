@@ -0,0 +1,25 @@
+package okta
+
+import "time"
+
+// CredentialProcessOutput is the JSON schema the AWS CLI/SDKs expect from a
+// `credential_process` entry in ~/.aws/config.
+type CredentialProcessOutput struct {
+	Version         int    `json:"Version"`
+	AccessKeyId     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Expiration      string `json:"Expiration"`
+}
+
+// CredentialProcess returns o's current credentials in the
+// credential_process JSON schema. Callers should Authenticate first.
+func (o *OktaClient) CredentialProcess() CredentialProcessOutput {
+	return CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     o.AccessKeyId,
+		SecretAccessKey: o.SecretAccessKey,
+		SessionToken:    o.SessionToken,
+		Expiration:      o.Expiration.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,80 @@
+package okta
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// imdsCredentialsPath is the EC2 IMDS path that lists (and, suffixed with
+// a role name, serves) instance-profile credentials. Only the IMDSv1 GET
+// endpoints are implemented here; there is no PUT /latest/api/token
+// handler, so IMDSv2-only clients (which require a token before they'll
+// fetch credentials) won't work against this server.
+const imdsCredentialsPath = "/latest/meta-data/iam/security-credentials/"
+
+// IMDSCredentials is the JSON schema EC2 instance metadata returns from
+// iam/security-credentials/<role>.
+type IMDSCredentials struct {
+	Code            string `json:"Code"`
+	LastUpdated     string `json:"LastUpdated"`
+	Type            string `json:"Type"`
+	AccessKeyId     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration"`
+}
+
+// IMDSServer emulates the EC2 instance-metadata-service credential
+// endpoints (IMDSv1 style) for tools that only know how to fetch
+// credentials that way. Client is re-authenticated on every request, which
+// is cheap once cached STS credentials are live and transparently
+// refreshes them once they expire.
+//
+// http.ListenAndServe handles each request on its own goroutine, so
+// Authenticate (which mutates Client's credential fields) and the
+// subsequent read of those fields are serialized behind mu to keep
+// concurrent requests from serving a torn mix of old/new key material.
+type IMDSServer struct {
+	Client  *OktaClient
+	RoleArn string
+	Profile string
+	Role    string
+
+	mu sync.Mutex
+}
+
+func (s *IMDSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case imdsCredentialsPath:
+		w.Write([]byte(s.Role))
+	case imdsCredentialsPath + s.Role:
+		s.serveCredentials(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *IMDSServer) serveCredentials(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.Client.Authenticate(s.RoleArn, s.Profile); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	creds := IMDSCredentials{
+		Code:            "Success",
+		LastUpdated:     time.Now().UTC().Format(time.RFC3339),
+		Type:            "AWS-HMAC",
+		AccessKeyId:     s.Client.AccessKeyId,
+		SecretAccessKey: s.Client.SecretAccessKey,
+		Token:           s.Client.SessionToken,
+		Expiration:      s.Client.Expiration.UTC().Format(time.RFC3339),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(creds)
+}
@@ -0,0 +1,203 @@
+package okta
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/manifoldco/promptui"
+)
+
+// oktaFactorVerifyPayload is the body Okta expects on
+// api/v1/authn/factors/{id}/verify. passCode is only set for TOTP/SMS/call
+// factors; Duo and push are driven by StateToken alone.
+type oktaFactorVerifyPayload struct {
+	StateToken string `json:"stateToken"`
+	PassCode   string `json:"passCode,omitempty"`
+}
+
+// challengeMFA selects an MFA factor and drives it to completion,
+// dispatching on factor type: "web" (Duo U2F), "token:software:totp",
+// "push" (Okta Verify), and "sms"/"call".
+func (o *OktaClient) challengeMFA() (err error) {
+	factors := o.UserAuth.Embedded.Factors
+	if len(factors) == 0 {
+		return
+	}
+
+	factor, err := o.selectFactor(factors)
+	if err != nil {
+		return
+	}
+	log.Debugf("Okta Factor: %s (%s)\n", factor.Id, factor.FactorType)
+
+	switch factor.FactorType {
+	case "web":
+		err = o.challengeDuo(factor.Id)
+	case "token:software:totp":
+		err = o.challengeTOTP(factor.Id)
+	case "push":
+		err = o.challengePush(factor.Id)
+	case "sms", "call":
+		err = o.challengeOutOfBand(factor.Id)
+	default:
+		err = fmt.Errorf("factor %s not supported", factor.FactorType)
+	}
+	return
+}
+
+// selectFactor picks which MFA factor to use: the profile's configured
+// mfa_factor if it matches one of the available factors, the only factor
+// if there's just one, otherwise an interactive prompt.
+func (o *OktaClient) selectFactor(factors []OktaUserAuthnFactor) (factor OktaUserAuthnFactor, err error) {
+	cfg, err := LoadProfileConfig(o.Profile)
+	if err != nil {
+		return
+	}
+	if cfg.MFAFactor != "" {
+		for _, f := range factors {
+			if f.FactorType == cfg.MFAFactor {
+				return f, nil
+			}
+		}
+		log.Warnf("configured mfa_factor %s not found, falling back", cfg.MFAFactor)
+	}
+
+	if len(factors) == 1 {
+		return factors[0], nil
+	}
+
+	prompt := promptui.Select{
+		Label: "Select an MFA factor",
+		Items: factors,
+		Templates: &promptui.SelectTemplates{
+			Active:   `{{ .FactorType }}`,
+			Inactive: `{{ .FactorType }}`,
+			Selected: `{{ .FactorType }}`,
+		},
+	}
+	i, _, err := prompt.Run()
+	if err != nil {
+		return
+	}
+	return factors[i], nil
+}
+
+func (o *OktaClient) verifyFactor(factorId string, payload oktaFactorVerifyPayload) (err error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	return o.Get("POST", "api/v1/authn/factors/"+factorId+"/verify", data, &o.UserAuth, "json")
+}
+
+// challengeDuo drives the Duo U2F flow: a signed push/prompt from Duo's own
+// SDK happens out of band, while we poll Okta for the resulting status.
+func (o *OktaClient) challengeDuo(factorId string) (err error) {
+	var wg sync.WaitGroup
+
+	payload := oktaFactorVerifyPayload{StateToken: o.UserAuth.StateToken}
+	err = o.verifyFactor(factorId, payload)
+	if err != nil {
+		return
+	}
+
+	if o.UserAuth.Status != "MFA_CHALLENGE" {
+		return
+	}
+
+	f := o.UserAuth.Embedded.Factor
+	o.DuoClient = &DuoClient{
+		Host:       f.Embedded.Verification.Host,
+		Signature:  f.Embedded.Verification.Signature,
+		Callback:   f.Embedded.Verification.Links.Complete.Href,
+		StateToken: o.UserAuth.StateToken,
+	}
+
+	log.Debugf("Host:%s\nSignature:%s\nStateToken:%s\n",
+		f.Embedded.Verification.Host, f.Embedded.Verification.Signature,
+		o.UserAuth.StateToken)
+
+	wg.Add(1)
+	go func() {
+		log.Info("challenge u2f")
+		err = o.DuoClient.ChallengeU2f()
+		if err != nil {
+			wg.Done()
+		}
+	}()
+
+	// Poll Okta until Duo authentication has been completed
+	for o.UserAuth.Status != "SUCCESS" {
+		if err = o.verifyFactor(factorId, payload); err != nil {
+			return
+		}
+		time.Sleep(2 * time.Second)
+	}
+	wg.Done()
+	wg.Wait()
+	return
+}
+
+// challengePush triggers an Okta Verify push and polls until the user
+// approves or rejects it, or it times out.
+func (o *OktaClient) challengePush(factorId string) (err error) {
+	payload := oktaFactorVerifyPayload{StateToken: o.UserAuth.StateToken}
+
+	log.Info("waiting for Okta Verify push approval")
+	for {
+		if err = o.verifyFactor(factorId, payload); err != nil {
+			return
+		}
+
+		switch o.UserAuth.Status {
+		case "SUCCESS":
+			return nil
+		case "REJECTED":
+			return fmt.Errorf("Okta Verify push was rejected")
+		case "TIMEOUT":
+			return fmt.Errorf("Okta Verify push timed out")
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// challengeTOTP prompts for a 6-digit code from a software token
+// (Okta Verify TOTP or Google Authenticator) and verifies it.
+func (o *OktaClient) challengeTOTP(factorId string) (err error) {
+	code, err := promptForCode("Enter TOTP code")
+	if err != nil {
+		return
+	}
+
+	return o.verifyFactor(factorId, oktaFactorVerifyPayload{
+		StateToken: o.UserAuth.StateToken,
+		PassCode:   code,
+	})
+}
+
+// challengeOutOfBand triggers an SMS or voice call challenge and then
+// prompts for the code it delivers.
+func (o *OktaClient) challengeOutOfBand(factorId string) (err error) {
+	err = o.verifyFactor(factorId, oktaFactorVerifyPayload{StateToken: o.UserAuth.StateToken})
+	if err != nil {
+		return
+	}
+
+	code, err := promptForCode("Enter code")
+	if err != nil {
+		return
+	}
+
+	return o.verifyFactor(factorId, oktaFactorVerifyPayload{
+		StateToken: o.UserAuth.StateToken,
+		PassCode:   code,
+	})
+}
+
+func promptForCode(label string) (code string, err error) {
+	prompt := promptui.Prompt{Label: label}
+	return prompt.Run()
+}
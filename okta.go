@@ -8,24 +8,19 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"strings"
-	"sync"
 	"time"
 
 	"golang.org/x/net/publicsuffix"
 
 	"github.com/apex/log"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/segmentio/aws-okta/saml"
 )
 
 const (
-	OktaServer       = "okta.com"
-	OktaOrganization = "segment"
-	OktaAwsSAMLUrl   = "home/amazon_aws/0oa25q58sjnJXnvIg1t7/272"
+	OktaServer     = "okta.com"
+	OktaAwsSAMLUrl = "home/amazon_aws/0oa25q58sjnJXnvIg1t7/272"
 
 	KeystoreName    = "aws-okta"
 	KeystoreOktaKey = "okta-login"
@@ -34,14 +29,20 @@ const (
 
 type OktaClient struct {
 	Organization    string
+	Domain          string
 	Username        string
 	Password        string
+	Profile         string
 	UserAuth        *OktaUserAuthn
 	DuoClient       *DuoClient
 	AccessKeyId     string
 	SecretAccessKey string
 	SessionToken    string
 	Expiration      time.Time
+
+	// jar is reused across Get calls so an Okta session cookie set by one
+	// request (e.g. creating a session) is sent on the next one.
+	jar *cookiejar.Jar
 }
 
 type SAMLAssertion struct {
@@ -49,19 +50,51 @@ type SAMLAssertion struct {
 	RawData []byte
 }
 
-func NewOktaClient(organization, username, password string) *OktaClient {
+// NewOktaClient builds a client for organization on domain (e.g. "okta.com").
+// An empty domain falls back to OktaServer so existing Segment callers are
+// unaffected.
+func NewOktaClient(organization, domain, username, password string) *OktaClient {
+	if domain == "" {
+		domain = OktaServer
+	}
 	return &OktaClient{
 		Organization: organization,
+		Domain:       domain,
 		Username:     username,
 		Password:     password,
 	}
 }
 
+// Authenticate exchanges a SAML assertion for AWS credentials for roleArn,
+// via AuthenticateViaSAML with o as the SAMLProvider. profile selects the
+// config entry (SAML app URL, MFA factor, source_role, region, duration),
+// keys the cached STS credentials and names the resulting STS session.
 func (o *OktaClient) Authenticate(roleArn, profile string) (err error) {
+	o.Profile = profile
+
+	creds, err := AuthenticateViaSAML(o, roleArn, profile)
+	if err != nil {
+		return
+	}
+
+	o.AccessKeyId = creds.AccessKeyId
+	o.SecretAccessKey = creds.SecretAccessKey
+	o.SessionToken = creds.SessionToken
+	o.Expiration = creds.Expiration
+	return
+}
+
+// Login runs the Okta username/password + MFA flow, or restores a cached
+// Okta session cookie if one is still live. Either way, subsequent Get
+// calls against o are authenticated.
+func (o *OktaClient) Login() (err error) {
 	var payload []byte
 	var oktaUserAuthn OktaUserAuthn
-	var assertion SAMLAssertion
-	var awsRoles []string
+
+	if o.restoreOktaSession() {
+		log.Debug("reusing cached Okta session, skipping password/MFA")
+		return nil
+	}
 
 	// Step 1 : Basic authentication
 	user := OktaUser{
@@ -93,72 +126,47 @@ func (o *OktaClient) Authenticate(roleArn, profile string) (err error) {
 		return
 	}
 
-	// Step 3 : Get SAML Assertion and retrieve IAM Roles
-	log.Debug("Step: 3")
-	assertion = SAMLAssertion{}
-	err = o.Get("GET", OktaAwsSAMLUrl+"?onetimetoken="+o.UserAuth.SessionToken,
-		nil, &assertion, "saml")
-	if err != nil {
-		return
+	if err = o.persistOktaSession(); err != nil {
+		log.Debugf("could not cache Okta session: %s", err)
+		err = nil
 	}
+	return
+}
 
-	awsRoles, err = GetRolesFromSAML(assertion.Resp)
+// GetSAMLAssertion runs Login, then fetches the raw SAML assertion for the
+// AWS app along with the "principalArn,roleArn" pairs it encodes. It
+// implements SAMLProvider.
+func (o *OktaClient) GetSAMLAssertion() (rawAssertion string, awsRoles []string, err error) {
+	var assertion SAMLAssertion
+
+	appURL, err := samlAppURL(o.Profile)
 	if err != nil {
 		return
 	}
 
-	if len(awsRoles) == 0 {
-		err = fmt.Errorf("do AWS Roles found for user %s\n", o.Username)
+	if err = o.Login(); err != nil {
 		return
 	}
-	awsRole := SelectAWSRoles(awsRoles)
-	arns := strings.Split(awsRole, ",")
-
-	// Step 4 : Assume Role with SAML
-	samlSess := session.Must(session.NewSession())
-	svc := sts.New(samlSess)
-
-	log.Debugf("assuming first role with SAML : %v\n", arns)
 
-	samlParams := &sts.AssumeRoleWithSAMLInput{
-		PrincipalArn:    aws.String(arns[0]),
-		RoleArn:         aws.String(arns[1]),
-		SAMLAssertion:   aws.String(string(assertion.RawData)),
-		DurationSeconds: aws.Int64(3600),
+	samlPath := appURL
+	if o.UserAuth != nil && o.UserAuth.SessionToken != "" {
+		samlPath = appURL + "?onetimetoken=" + o.UserAuth.SessionToken
 	}
 
-	samlResp, err := svc.AssumeRoleWithSAML(samlParams)
+	// Step 3 : Get SAML Assertion and retrieve IAM Roles
+	log.Debug("Step: 3")
+	assertion = SAMLAssertion{}
+	err = o.Get("GET", samlPath, nil, &assertion, "saml")
 	if err != nil {
-		log.WithField("role", arns[0]).Errorf(
-			"error assuming role with SAML: %s", err.Error())
 		return
 	}
 
-	// Step 5 : Chain to final Role and get temporary credentials
-	client := sts.New(session.New(&aws.Config{Credentials: credentials.NewStaticCredentials(
-		*samlResp.Credentials.AccessKeyId,
-		*samlResp.Credentials.SecretAccessKey,
-		*samlResp.Credentials.SessionToken,
-	)}))
-
-	log.Debugf("assuming role %s with profile %s\n", roleArn, profile)
-
-	params := &sts.AssumeRoleInput{
-		RoleArn:         aws.String(roleArn),
-		RoleSessionName: aws.String("okta-" + profile),
-	}
-	resp, err := client.AssumeRole(params)
+	awsRoles, err = GetRolesFromSAML(assertion.Resp)
 	if err != nil {
-		log.WithField("role", roleArn).Errorf(
-			"error assuming role: %s", err.Error())
 		return
 	}
 
-	o.AccessKeyId = *resp.Credentials.AccessKeyId
-	o.SecretAccessKey = *resp.Credentials.SecretAccessKey
-	o.SessionToken = *resp.Credentials.SessionToken
-	o.Expiration = *resp.Credentials.Expiration
-
+	rawAssertion = string(assertion.RawData)
 	return
 }
 
@@ -172,86 +180,18 @@ func (o *OktaClient) GetCredentials() (creds sts.Credentials, err error) {
 	return
 }
 
-//TODO: The selection of the AWS role should be done using "source_role"
-//		from the configuration
-func SelectAWSRoles(roles []string) (role string) {
-	return roles[0]
+func newCookieJar() (*cookiejar.Jar, error) {
+	return cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
 }
 
-func (o *OktaClient) challengeMFA() (err error) {
-	var oktaFactorId string
-	var payload []byte
-	var wg sync.WaitGroup
-
-	for _, f := range o.UserAuth.Embedded.Factors {
-		oktaFactorId, err = GetFactorId(&f)
+// HTTPClient returns an http.Client sharing o's (authenticated, once Login
+// has run) cookie jar, for callers that need to fetch pages Get doesn't
+// know how to parse, e.g. the Okta dashboard during app discovery.
+func (o *OktaClient) HTTPClient() *http.Client {
+	if o.jar == nil {
+		o.jar, _ = newCookieJar()
 	}
-	if oktaFactorId == "" {
-		return
-	}
-	log.Debugf("Okta Factor ID: %s\n", oktaFactorId)
-
-	payload, err = json.Marshal(OktaStateToken{
-		StateToken: o.UserAuth.StateToken,
-	})
-	if err != nil {
-		return
-	}
-
-	err = o.Get("POST", "api/v1/authn/factors/"+oktaFactorId+"/verify",
-		payload, &o.UserAuth, "json",
-	)
-	if err != nil {
-		return
-	}
-
-	if o.UserAuth.Status == "MFA_CHALLENGE" {
-		f := o.UserAuth.Embedded.Factor
-
-		o.DuoClient = &DuoClient{
-			Host:       f.Embedded.Verification.Host,
-			Signature:  f.Embedded.Verification.Signature,
-			Callback:   f.Embedded.Verification.Links.Complete.Href,
-			StateToken: o.UserAuth.StateToken,
-		}
-
-		log.Debugf("Host:%s\nSignature:%s\nStateToken:%s\n",
-			f.Embedded.Verification.Host, f.Embedded.Verification.Signature,
-			o.UserAuth.StateToken)
-
-		wg.Add(1)
-		go func() {
-			log.Info("challenge u2f")
-			err = o.DuoClient.ChallengeU2f()
-			if err != nil {
-				wg.Done()
-			}
-		}()
-
-		// Poll Okta until Duo authentication has been completed
-		for o.UserAuth.Status != "SUCCESS" {
-			err = o.Get("POST", "api/v1/authn/factors/"+oktaFactorId+"/verify",
-				payload, &o.UserAuth, "json",
-			)
-			if err != nil {
-				return
-			}
-			time.Sleep(2 * time.Second)
-		}
-		wg.Done()
-		wg.Wait()
-	}
-	return
-}
-
-func GetFactorId(f *OktaUserAuthnFactor) (id string, err error) {
-	switch f.FactorType {
-	case "web":
-		id = f.Id
-	default:
-		err = fmt.Errorf("factor %s not supported", f.FactorType)
-	}
-	return
+	return &http.Client{Jar: o.jar}
 }
 
 func (o *OktaClient) Get(method string, path string, data []byte, recv interface{}, format string) (err error) {
@@ -260,10 +200,9 @@ func (o *OktaClient) Get(method string, path string, data []byte, recv interface
 	var body []byte
 	var header http.Header
 	var client http.Client
-	var jar *cookiejar.Jar
 
 	url, err = url.Parse(fmt.Sprintf(
-		"https://%s.%s/%s", o.Organization, OktaServer, path,
+		"https://%s.%s/%s", o.Organization, o.Domain, path,
 	))
 
 	if format == "json" {
@@ -274,12 +213,14 @@ func (o *OktaClient) Get(method string, path string, data []byte, recv interface
 		}
 	}
 
-	jar, err = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
-	if err != nil {
-		return
+	if o.jar == nil {
+		o.jar, err = newCookieJar()
+		if err != nil {
+			return
+		}
 	}
 	client = http.Client{
-		Jar: jar,
+		Jar: o.jar,
 	}
 
 	req := &http.Request{
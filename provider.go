@@ -0,0 +1,94 @@
+package okta
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apex/log"
+	awssts "github.com/segmentio/aws-okta/aws"
+)
+
+// SAMLProvider is implemented by anything that can authenticate a user with
+// an identity provider and hand back the raw SAML assertion Okta/ADFS/Ping
+// produced, along with the list of "principalArn,roleArn" pairs encoded in
+// it. OktaClient is the first implementation; ADFS, Ping, and
+// Keycloak-direct providers can be added without touching the AWS
+// credential exchange in the aws package.
+type SAMLProvider interface {
+	GetSAMLAssertion() (rawAssertion string, awsRoles []string, err error)
+}
+
+// AuthenticateViaSAML drives any SAMLProvider to get a SAML assertion, then
+// assumes roleArn through it via the aws package's STS calls. Role
+// selection, per-profile config (region, duration, source_role) and the
+// keyring-backed STS session cache are all handled here so a new
+// SAMLProvider implementation gets them for free instead of having to
+// reimplement them alongside its own STS calls.
+func AuthenticateViaSAML(provider SAMLProvider, roleArn, profile string) (creds *awssts.Credentials, err error) {
+	if sess, ok := loadSTSSession(profile); ok && sess.RoleArn == roleArn && sess.Expiration.After(time.Now().Add(sessionExpiryBuffer)) {
+		log.Debugf("using cached STS credentials for profile %s", profile)
+		return &awssts.Credentials{
+			AccessKeyId:     sess.AccessKeyId,
+			SecretAccessKey: sess.SecretAccessKey,
+			SessionToken:    sess.SessionToken,
+			Expiration:      sess.Expiration,
+		}, nil
+	}
+
+	rawAssertion, awsRoles, err := provider.GetSAMLAssertion()
+	if err != nil {
+		return
+	}
+
+	if len(awsRoles) == 0 {
+		err = fmt.Errorf("no AWS roles found for profile %s", profile)
+		return
+	}
+	parsedRoles, err := ParseAWSRoles(awsRoles)
+	if err != nil {
+		return
+	}
+	role, err := SelectAWSRoles(profile, parsedRoles)
+	if err != nil {
+		return
+	}
+
+	profileCfg, err := LoadProfileConfig(profile)
+	if err != nil {
+		return
+	}
+	region := profileCfg.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+	duration := time.Duration(profileCfg.DurationSeconds) * time.Second
+	if duration == 0 {
+		duration = DefaultDuration * time.Second
+	}
+
+	log.Debugf("assuming role with SAML : %s\n", role)
+	samlCreds, err := awssts.AssumeSAMLRole(role.PrincipalArn, role.RoleArn, rawAssertion, duration, region)
+	if err != nil {
+		log.WithField("role", role.PrincipalArn).Errorf(
+			"error assuming role with SAML: %s", err.Error())
+		return
+	}
+
+	log.Debugf("assuming role %s with profile %s\n", roleArn, profile)
+	creds, err = awssts.ChainAssumeRole(samlCreds, roleArn, "okta-"+profile, duration, region)
+	if err != nil {
+		log.WithField("role", roleArn).Errorf(
+			"error assuming role: %s", err.Error())
+		return
+	}
+
+	saveSTSSession(profile, stsSession{
+		RoleArn:         roleArn,
+		AccessKeyId:     creds.AccessKeyId,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      creds.Expiration,
+	})
+
+	return
+}
@@ -0,0 +1,143 @@
+package okta
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/99designs/keyring"
+	"github.com/apex/log"
+	"github.com/manifoldco/promptui"
+)
+
+// AWSRole is a single <principal, role> pair offered by a SAML assertion.
+type AWSRole struct {
+	PrincipalArn string
+	RoleArn      string
+}
+
+// Account returns the AWS account id embedded in the role ARN.
+func (r AWSRole) Account() string {
+	parts := strings.Split(r.RoleArn, ":")
+	if len(parts) < 5 {
+		return r.RoleArn
+	}
+	return parts[4]
+}
+
+// Name returns the role name embedded in the role ARN.
+func (r AWSRole) Name() string {
+	parts := strings.SplitN(r.RoleArn, "/", 2)
+	if len(parts) < 2 {
+		return r.RoleArn
+	}
+	return parts[1]
+}
+
+func (r AWSRole) String() string {
+	return fmt.Sprintf("%s (%s)", r.Name(), r.Account())
+}
+
+// ParseAWSRoles turns the "principalArn,roleArn" pairs returned by
+// GetRolesFromSAML into AWSRole values.
+func ParseAWSRoles(raw []string) (roles []AWSRole, err error) {
+	for _, r := range raw {
+		arns := strings.Split(r, ",")
+		if len(arns) != 2 {
+			err = fmt.Errorf("malformed AWS role pair: %s", r)
+			return
+		}
+		roles = append(roles, AWSRole{PrincipalArn: arns[0], RoleArn: arns[1]})
+	}
+	return
+}
+
+// SelectAWSRoles picks the AWSRole to assume for profile out of roles. It
+// prefers, in order: an unambiguous match against the profile's
+// source_role config, the only available role, the role remembered from a
+// prior run, and finally an interactive picker whose choice is remembered
+// for next time.
+func SelectAWSRoles(profile string, roles []AWSRole) (role AWSRole, err error) {
+	if len(roles) == 0 {
+		err = fmt.Errorf("no AWS roles available to select from")
+		return
+	}
+
+	cfg, err := LoadProfileConfig(profile)
+	if err != nil {
+		return
+	}
+	if cfg.SourceRole != "" {
+		for _, r := range roles {
+			if r.RoleArn == cfg.SourceRole {
+				return r, nil
+			}
+		}
+		log.Warnf("configured source_role %s not found in SAML roles for profile %s", cfg.SourceRole, profile)
+	}
+
+	if len(roles) == 1 {
+		return roles[0], nil
+	}
+
+	if cached, ok := getCachedRole(profile); ok {
+		for _, r := range roles {
+			if r.RoleArn == cached {
+				return r, nil
+			}
+		}
+	}
+
+	role, err = promptForRole(roles)
+	if err != nil {
+		return
+	}
+	setCachedRole(profile, role.RoleArn)
+	return
+}
+
+func promptForRole(roles []AWSRole) (role AWSRole, err error) {
+	prompt := promptui.Select{
+		Label: "Select an AWS role",
+		Items: roles,
+	}
+
+	i, _, err := prompt.Run()
+	if err != nil {
+		return
+	}
+	role = roles[i]
+	return
+}
+
+func cachedRoleKey(profile string) string {
+	return "role-" + profile
+}
+
+func getCachedRole(profile string) (roleArn string, ok bool) {
+	ring, err := keyring.Open(keyring.Config{ServiceName: KeystoreName})
+	if err != nil {
+		return
+	}
+
+	item, err := ring.Get(cachedRoleKey(profile))
+	if err != nil {
+		return
+	}
+	return string(item.Data), true
+}
+
+func setCachedRole(profile, roleArn string) {
+	ring, err := keyring.Open(keyring.Config{ServiceName: KeystoreName})
+	if err != nil {
+		log.Debugf("could not open keyring to remember role choice: %s", err)
+		return
+	}
+
+	err = ring.Set(keyring.Item{
+		Key:  cachedRoleKey(profile),
+		Data: []byte(roleArn),
+	})
+	if err != nil {
+		log.Debugf("could not remember role choice: %s", err)
+	}
+}
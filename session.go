@@ -0,0 +1,174 @@
+package okta
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/apex/log"
+)
+
+// sessionExpiryBuffer is subtracted from a cached credential's expiration
+// so a run doesn't start using creds that are about to expire mid-flight.
+const sessionExpiryBuffer = 5 * time.Minute
+
+// oktaSessionCookieName is the cookie Okta uses to recognize an existing
+// session (see POST /api/v1/sessions in the Okta API docs).
+const oktaSessionCookieName = "sid"
+
+// stsSession is the cached, per-profile result of assuming an AWS role.
+// RoleArn records which role the cached credentials were issued for, so a
+// cache entry left over from a since-changed profile (role renamed,
+// account migrated, one-off --role-arn override) isn't mistaken for a
+// match.
+type stsSession struct {
+	RoleArn         string    `json:"roleArn"`
+	AccessKeyId     string    `json:"accessKeyId"`
+	SecretAccessKey string    `json:"secretAccessKey"`
+	SessionToken    string    `json:"sessionToken"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// oktaSession is the cached Okta session cookie, shared across profiles for
+// a given organization/domain.
+type oktaSession struct {
+	Cookie     string    `json:"cookie"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// oktaSessionResponse is the subset of POST /api/v1/sessions we care about.
+type oktaSessionResponse struct {
+	Id        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// oktaSessionTokenPayload is the body POST /api/v1/sessions expects. It is
+// distinct from oktaFactorVerifyPayload (used to verify MFA factors), which
+// has an unrelated "stateToken" field.
+type oktaSessionTokenPayload struct {
+	SessionToken string `json:"sessionToken"`
+}
+
+func openKeyring() (keyring.Keyring, error) {
+	return keyring.Open(keyring.Config{ServiceName: KeystoreName})
+}
+
+func stsSessionKey(profile string) string {
+	return KeystoreOktaKey + "-sts-" + profile
+}
+
+// oktaSessionKey scopes the cached Okta session cookie to a single
+// organization/domain, so switching profiles across Okta orgs can't
+// restore another org's session.
+func oktaSessionKey(organization, domain string) string {
+	return KeystoreOktaKey + "-" + organization + "." + domain
+}
+
+func loadSTSSession(profile string) (sess stsSession, ok bool) {
+	ring, err := openKeyring()
+	if err != nil {
+		return
+	}
+	item, err := ring.Get(stsSessionKey(profile))
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(item.Data, &sess); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func saveSTSSession(profile string, sess stsSession) {
+	ring, err := openKeyring()
+	if err != nil {
+		log.Debugf("could not open keyring to cache STS session: %s", err)
+		return
+	}
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return
+	}
+	err = ring.Set(keyring.Item{Key: stsSessionKey(profile), Data: data})
+	if err != nil {
+		log.Debugf("could not cache STS session: %s", err)
+	}
+}
+
+func loadOktaSession(organization, domain string) (sess oktaSession, ok bool) {
+	ring, err := openKeyring()
+	if err != nil {
+		return
+	}
+	item, err := ring.Get(oktaSessionKey(organization, domain))
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(item.Data, &sess); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+func saveOktaSession(organization, domain string, sess oktaSession) {
+	ring, err := openKeyring()
+	if err != nil {
+		log.Debugf("could not open keyring to cache Okta session: %s", err)
+		return
+	}
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return
+	}
+	err = ring.Set(keyring.Item{Key: oktaSessionKey(organization, domain), Data: data})
+	if err != nil {
+		log.Debugf("could not cache Okta session: %s", err)
+	}
+}
+
+// restoreOktaSession loads a cached Okta session cookie, if any is still
+// live, into o's cookie jar so the next request is recognized without
+// re-running username/password + MFA.
+func (o *OktaClient) restoreOktaSession() bool {
+	sess, ok := loadOktaSession(o.Organization, o.Domain)
+	if !ok || !sess.Expiration.After(time.Now().Add(sessionExpiryBuffer)) {
+		return false
+	}
+
+	if o.jar == nil {
+		var err error
+		o.jar, err = newCookieJar()
+		if err != nil {
+			return false
+		}
+	}
+
+	orgUrl, err := url.Parse("https://" + o.Organization + "." + o.Domain)
+	if err != nil {
+		return false
+	}
+	o.jar.SetCookies(orgUrl, []*http.Cookie{{Name: oktaSessionCookieName, Value: sess.Cookie}})
+	return true
+}
+
+// persistOktaSession exchanges the just-obtained Okta sessionToken for a
+// session cookie (POST /api/v1/sessions) and caches it so future runs can
+// skip username/password + MFA until it expires.
+func (o *OktaClient) persistOktaSession() (err error) {
+	payload, err := json.Marshal(oktaSessionTokenPayload{SessionToken: o.UserAuth.SessionToken})
+	if err != nil {
+		return
+	}
+
+	var resp oktaSessionResponse
+	if err = o.Get("POST", "api/v1/sessions?additionalFields=cookieToken", payload, &resp, "json"); err != nil {
+		return
+	}
+
+	saveOktaSession(o.Organization, o.Domain, oktaSession{Cookie: resp.Id, Expiration: resp.ExpiresAt})
+	return
+}